@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+)
+
+const cacheBlobsDir = "blobs/sha256"
+
+// Cache is an on-disk, content-addressed store of downloaded blobs shared
+// across model pulls (e.g. falcon-7b and falcon-7b-instruct reusing the
+// same tokenizer/config files, or multiple pods on a node re-pulling the
+// same shard), similar to how OCI/estargz-style tooling dedupes layers.
+// Blobs are keyed by sha256(content); a caller that already knows a file's
+// digest (from a Manifest or HF LFS pointer) can short-circuit the download
+// entirely by hardlinking from the cache.
+type Cache struct {
+	Dir string
+}
+
+func NewCache(dir string) *Cache {
+	return &Cache{Dir: dir}
+}
+
+// defaultCacheDir returns $XDG_CACHE_HOME/kaito/weights, falling back to
+// ~/.cache/kaito/weights when XDG_CACHE_HOME is unset.
+func defaultCacheDir() string {
+	if dir := os.Getenv("XDG_CACHE_HOME"); dir != "" {
+		return filepath.Join(dir, "kaito", "weights")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "kaito", "weights")
+	}
+	return filepath.Join(home, ".cache", "kaito", "weights")
+}
+
+func (c *Cache) blobPath(sha256Hex string) string {
+	return filepath.Join(c.Dir, cacheBlobsDir, sha256Hex)
+}
+
+func (c *Cache) lockPath(sha256Hex string) string {
+	return c.blobPath(sha256Hex) + ".lock"
+}
+
+// lock acquires an exclusive flock on the blob's lock file so concurrent
+// kaito-weights invocations on the same node coalesce onto a single
+// download of that blob rather than racing. The returned unlock must be
+// called once the caller is done with the blob.
+func (c *Cache) lock(sha256Hex string) (unlock func(), err error) {
+	if err := os.MkdirAll(filepath.Dir(c.lockPath(sha256Hex)), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(c.lockPath(sha256Hex), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("locking %s: %w", c.lockPath(sha256Hex), err)
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
+
+// has reports whether sha256Hex is already present in the cache.
+func (c *Cache) has(sha256Hex string) bool {
+	info, err := os.Stat(c.blobPath(sha256Hex))
+	return err == nil && !info.IsDir()
+}
+
+// link places the cached blob for sha256Hex at dst, hardlinking when the
+// cache and destination share a filesystem and falling back to a copy
+// across filesystems. It also bumps the blob's mtime so gc's
+// keep-most-recently-used ordering reflects last access, not just
+// creation.
+func (c *Cache) link(sha256Hex, dst string) error {
+	src := c.blobPath(sha256Hex)
+	now := time.Now()
+	os.Chtimes(src, now, now)
+
+	if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+	return copyFile(src, dst)
+}
+
+// put moves a freshly downloaded (and already verified) file from src into
+// the cache under its sha256, then links it into dst. src and dst may be
+// the same path.
+func (c *Cache) put(sha256Hex, src, dst string) error {
+	blob := c.blobPath(sha256Hex)
+	if err := os.MkdirAll(filepath.Dir(blob), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(src, blob); err != nil {
+		if cerr := copyFile(src, blob); cerr != nil {
+			return cerr
+		}
+		os.Remove(src)
+	}
+	return c.link(sha256Hex, dst)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, in)
+	return err
+}
+
+// gc removes cached blobs beyond the keepLatest most recently used (by
+// mtime, bumped on every link).
+func (c *Cache) gc(keepLatest int) error {
+	dir := filepath.Join(c.Dir, cacheBlobsDir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	type blob struct {
+		path    string
+		modTime time.Time
+	}
+	var blobs []blob
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) == ".lock" {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		blobs = append(blobs, blob{path: filepath.Join(dir, e.Name()), modTime: info.ModTime()})
+	}
+
+	sort.Slice(blobs, func(i, j int) bool { return blobs[i].modTime.After(blobs[j].modTime) })
+
+	if keepLatest >= len(blobs) {
+		return nil
+	}
+	for _, b := range blobs[keepLatest:] {
+		if err := os.Remove(b.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		os.Remove(b.path + ".lock")
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCacheGCKeepsMostRecentlyUsed(t *testing.T) {
+	dir := t.TempDir()
+	c := NewCache(dir)
+
+	blobsDir := filepath.Join(dir, cacheBlobsDir)
+	if err := os.MkdirAll(blobsDir, 0755); err != nil {
+		t.Fatalf("setting up blobs dir: %v", err)
+	}
+
+	names := []string{"oldest", "older", "newer", "newest"}
+	base := time.Now().Add(-time.Hour)
+	for i, name := range names {
+		path := filepath.Join(blobsDir, name)
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatalf("writing blob %s: %v", name, err)
+		}
+		// Also drop a stale lock file next to it, which gc should clean up
+		// alongside any blob it removes.
+		if err := os.WriteFile(path+".lock", nil, 0644); err != nil {
+			t.Fatalf("writing lock file for %s: %v", name, err)
+		}
+		mtime := base.Add(time.Duration(i) * time.Minute)
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatalf("setting mtime for %s: %v", name, err)
+		}
+	}
+
+	if err := c.gc(2); err != nil {
+		t.Fatalf("gc: %v", err)
+	}
+
+	for _, name := range []string{"newer", "newest"} {
+		if _, err := os.Stat(filepath.Join(blobsDir, name)); err != nil {
+			t.Errorf("expected %s to survive gc(2), got: %v", name, err)
+		}
+	}
+	for _, name := range []string{"oldest", "older"} {
+		if _, err := os.Stat(filepath.Join(blobsDir, name)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed by gc(2), stat err: %v", name, err)
+		}
+		if _, err := os.Stat(filepath.Join(blobsDir, name+".lock")); !os.IsNotExist(err) {
+			t.Errorf("expected %s.lock to be removed alongside its blob, stat err: %v", name, err)
+		}
+	}
+}
+
+func TestCacheGCNoopWhenUnderLimit(t *testing.T) {
+	dir := t.TempDir()
+	c := NewCache(dir)
+
+	blobsDir := filepath.Join(dir, cacheBlobsDir)
+	if err := os.MkdirAll(blobsDir, 0755); err != nil {
+		t.Fatalf("setting up blobs dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(blobsDir, "only"), []byte("only"), 0644); err != nil {
+		t.Fatalf("writing blob: %v", err)
+	}
+
+	if err := c.gc(10); err != nil {
+		t.Fatalf("gc: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(blobsDir, "only")); err != nil {
+		t.Errorf("expected blob to survive gc(10) when under the limit, got: %v", err)
+	}
+}
+
+func TestCacheGCOnMissingCacheDirIsNoop(t *testing.T) {
+	c := NewCache(t.TempDir())
+	if err := c.gc(5); err != nil {
+		t.Fatalf("expected gc on a never-populated cache dir to be a no-op, got: %v", err)
+	}
+}
@@ -1,18 +1,19 @@
 /*
  * This script allows you to download llama and falcon weights using parallel wget.
  * Llama is to be downloaded via hosted web server.
- * Falcon from public url.
+ * Falcon (and any other public HF repo) is resolved dynamically against the
+ * Hugging Face Hub API rather than a hardcoded file list.
  */
 package main
 
 import (
+	"flag"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
 	"os"
 	"path/filepath"
-	"sync"
+
+	"golang.org/x/sync/errgroup"
 )
 
 const (
@@ -24,123 +25,34 @@ func getFilenameFromURL(url string) string {
 	return filepath.Base(url)
 }
 
-func downloadFile(folderPath string, url string, token string, wg *sync.WaitGroup) {
-	defer wg.Done()
-
-	fileName := getFilenameFromURL(url)
-	fp := filepath.Join(folderPath, fileName)
-
-	// Create the file
-	out, err := os.Create(fp)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer out.Close()
-
-	// Create new request
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		log.Fatal(err)
-	}
-	// If token is provided, add to request header
-	if token != "" {
-		req.Header.Add("Authorization", "Bearer "+token)
-	}
-
-	// Execute the request
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer resp.Body.Close()
-
-	// Track progress
-	totalBytes := resp.ContentLength
-	var bytesRead int64
-
-	progressReader := io.TeeReader(resp.Body, &WriteCounter{filename: fp, total: totalBytes, read: &bytesRead})
-
-	// Write the data to the file
-	_, err = io.Copy(out, progressReader)
-	if err != nil {
-		log.Fatal(err)
-	}
-}
-
-type WriteCounter struct {
-	filename     string
-	total        int64
-	read         *int64
-	lastReported int64
-}
-
-func (wc *WriteCounter) Write(p []byte) (int, error) {
-	n := len(p)
-	*wc.read += int64(n)
-
-	// Calculate every 1% increment of the total size
-	onePercent := wc.total / 100
-
-	// Check if the bytes read has surpassed another 1% increment since the last reported value
-	if *wc.read-wc.lastReported >= onePercent {
-		fmt.Printf("\rDownloading [%s]: %d out of %d bytes (%.2f%%)\n", filepath.Base(wc.filename), *wc.read, wc.total, float64(*wc.read)/float64(wc.total)*100)
-		wc.lastReported = *wc.read
-	}
-
-	return n, nil
-}
-
-func falconCommonURLs(modelVersion string) []string {
-	return []string{
-		fmt.Sprintf("https://huggingface.co/%s/raw/main/config.json", modelVersion),
-		fmt.Sprintf("https://huggingface.co/%s/raw/main/pytorch_model.bin.index.json", modelVersion),
-		fmt.Sprintf("https://huggingface.co/%s/raw/main/tokenizer.json", modelVersion),
-		fmt.Sprintf("https://huggingface.co/%s/raw/main/tokenizer_config.json", modelVersion),
-		fmt.Sprintf("https://huggingface.co/%s/raw/main/special_tokens_map.json", modelVersion),
-		fmt.Sprintf("https://huggingface.co/%s/raw/main/configuration_falcon.py", modelVersion),
-		fmt.Sprintf("https://huggingface.co/%s/raw/main/generation_config.json", modelVersion),
-		fmt.Sprintf("https://huggingface.co/%s/raw/main/modeling_falcon.py", modelVersion),
-	}
-}
-
-func falconModelURLs(modelVersion string, count int) (urls []string) {
-	for i := 1; i <= count; i++ {
-		url := fmt.Sprintf("https://huggingface.co/%s/resolve/main/pytorch_model-%05d-of-%05d.bin", modelVersion, i, count)
-		urls = append(urls, url)
-	}
-	return
-}
-
-func getURLsForModel(linkType, baseURL, modelVersion string) []string {
+// getURLsForModel resolves the set of files to download for modelVersion.
+// Public links are resolved dynamically against the Hugging Face Hub API
+// (modelVersion may be any HF repo id, e.g. "tiiuae/falcon-7b"); private
+// links still go through the hardcoded hosted-server layout below.
+func getURLsForModel(linkType, baseURL, modelVersion, token string) ([]string, error) {
 	if linkType == PublicLink {
-		switch modelVersion {
-		case "tiiuae/falcon-7b", "tiiuae/falcon-7b-instruct":
-			return append(falconModelURLs(modelVersion, 2), falconCommonURLs(modelVersion)...)
-		case "tiiuae/falcon-40b", "tiiuae/falcon-40b-instruct":
-			return append(falconModelURLs(modelVersion, 9), falconCommonURLs(modelVersion)...)
-		default:
-			log.Fatalf("Invalid model version for public link: %s", modelVersion)
-			return nil
+		urls, err := NewHuggingFaceResolver(token).ResolveFiles(modelVersion)
+		if err != nil {
+			return nil, fmt.Errorf("resolving files for %s: %w", modelVersion, err)
 		}
-	} else {
-		return getPrivateURLsForModel(baseURL, modelVersion)
+		return urls, nil
 	}
+	return getPrivateURLsForModel(baseURL, modelVersion)
 }
 
-func getPrivateURLsForModel(baseURL, modelVersion string) []string {
+func getPrivateURLsForModel(baseURL, modelVersion string) ([]string, error) {
 	switch modelVersion {
 	case "llama-2-7b", "llama-2-7b-chat":
 		return []string{
 			fmt.Sprintf("%s%s/consolidated.00.pth", baseURL, modelVersion),
 			fmt.Sprintf("%s%s/params.json", baseURL, modelVersion),
-		}
+		}, nil
 	case "llama-2-13b", "llama-2-13b-chat":
 		return []string{
 			fmt.Sprintf("%s%s/consolidated.00.pth", baseURL, modelVersion),
 			fmt.Sprintf("%s%s/consolidated.01.pth", baseURL, modelVersion),
 			fmt.Sprintf("%s%s/params.json", baseURL, modelVersion),
-		}
+		}, nil
 
 	case "llama-2-70b", "llama-2-70b-chat":
 		return []string{
@@ -152,55 +64,160 @@ func getPrivateURLsForModel(baseURL, modelVersion string) []string {
 			fmt.Sprintf("%s%s/consolidated.06.pth", baseURL, modelVersion),
 			fmt.Sprintf("%s%s/consolidated.07.pth", baseURL, modelVersion),
 			fmt.Sprintf("%s%s/params.json", baseURL, modelVersion),
-		}
+		}, nil
 
 	default:
-		log.Fatalf("Invalid model version for private link: %s", modelVersion)
-		return nil
+		return nil, fmt.Errorf("invalid model version for private link: %s", modelVersion)
 	}
 }
 
-func ensureDirExists(dirName string) {
+func ensureDirExists(dirName string) error {
 	if _, err := os.Stat(dirName); os.IsNotExist(err) {
-		err := os.MkdirAll(dirName, 0755)
-		if err != nil {
-			log.Fatalf("Failed to create directory: %v", err)
+		if err := os.MkdirAll(dirName, 0755); err != nil {
+			return fmt.Errorf("creating directory %s: %w", dirName, err)
 		}
 	}
+	return nil
 }
 
-func main() {
-	if len(os.Args) < 4 {
-		log.Fatalf("Usage: %s <link_type> <model_version> <output_directory> [external_IP] [external_port]", os.Args[0])
+func run() error {
+	connections := flag.Int("connections", defaultConnections, "number of parallel range requests per file (falls back to a single stream when the origin doesn't support ranges)")
+	noVerify := flag.Bool("no-verify", false, "skip manifest/SHA256 verification of downloaded files")
+	insecureSkipSignature := flag.Bool("insecure-skip-signature", false, "proceed without checking the manifest's signature even though no trusted signing key is embedded in this binary (per-file SHA256 checks still apply); required until a real key ships")
+	manifestPath := flag.String("manifest", "", "path to a local manifest.json (with accompanying .sig) to use instead of fetching one")
+	cacheDir := flag.String("cache-dir", defaultCacheDir(), "content-addressed cache directory shared across model pulls")
+	noCache := flag.Bool("no-cache", false, "don't use or populate the local content-addressed cache")
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) < 3 {
+		return fmt.Errorf("usage: %s [-connections=N] <link_type> <model_version> <output_directory> [external_IP] [external_port]", os.Args[0])
 	}
 
-	linkType := os.Args[1]
-	modelVersion := os.Args[2]
-	outputDirectory := os.Args[3]
-	ensureDirExists(outputDirectory)
+	linkType := args[0]
+	modelVersion := args[1]
+	outputDirectory := args[2]
+	if err := ensureDirExists(outputDirectory); err != nil {
+		return err
+	}
 
-	token := ""
+	// AUTH_TOKEN_ENV_VAR is required for private-link downloads and
+	// optional for public ones, where it's only needed for gated HF repos.
+	token := os.Getenv("AUTH_TOKEN_ENV_VAR")
 	baseURL := ""
 	if linkType == PrivateLink {
-		if len(os.Args) != 6 {
-			log.Fatalf("Usage (private link): %s <link_type> <model_version> <output_directory> <external_IP> <external_port>", os.Args[0])
+		if len(args) != 5 {
+			return fmt.Errorf("usage (private link): %s [-connections=N] <link_type> <model_version> <output_directory> <external_IP> <external_port>", os.Args[0])
 		}
-		token = os.Getenv("AUTH_TOKEN_ENV_VAR")
 		if token == "" {
-			log.Fatal("AUTH_TOKEN_ENV_VAR not set!")
+			return fmt.Errorf("AUTH_TOKEN_ENV_VAR not set")
 		}
-		externalIP := os.Args[4]
-		externalPort := os.Args[5]
+		externalIP := args[3]
+		externalPort := args[4]
 		baseURL = "http://" + externalIP + ":" + externalPort + "/download/"
 	}
 
-	urls := getURLsForModel(linkType, baseURL, modelVersion)
-	var wg sync.WaitGroup
+	urls, err := getURLsForModel(linkType, baseURL, modelVersion, token)
+	if err != nil {
+		return err
+	}
+
+	downloader := NewDownloader(*connections, token)
+	downloader.NoVerify = *noVerify
+	if !*noCache {
+		downloader.Cache = NewCache(*cacheDir)
+	}
+
+	// Ground-truth hashes are resolved regardless of -no-verify: the cache
+	// keys off them too, so skipping verification shouldn't silently turn
+	// caching into a no-op as a side effect. -no-verify only controls
+	// whether Downloader enforces a mismatch (see Downloader.verifyFile);
+	// when it's set, a resolution failure here is a warning, not fatal.
+	// -no-verify also implies -insecure-skip-signature, since a user
+	// already asking not to enforce SHA256s has no reason to be blocked on
+	// the (currently unshippable) manifest signature instead.
+	allowUnsignedManifest := *noVerify || *insecureSkipSignature
+	switch {
+	case *manifestPath != "":
+		manifest, err := loadManifestFile(*manifestPath, allowUnsignedManifest)
+		if err != nil {
+			if *noVerify {
+				log.Printf("warning: loading manifest %s failed (continuing due to -no-verify, cache disabled for this run): %v", *manifestPath, err)
+				break
+			}
+			return fmt.Errorf("loading manifest %s: %w", *manifestPath, err)
+		}
+		downloader.Manifest = manifest
+	case linkType == PrivateLink:
+		manifest, err := fetchManifest(downloader.Client, baseURL, modelVersion, token, allowUnsignedManifest)
+		if err != nil {
+			if *noVerify {
+				log.Printf("warning: fetching manifest failed (continuing due to -no-verify, cache disabled for this run): %v", err)
+				break
+			}
+			return fmt.Errorf("fetching manifest: %w", err)
+		}
+		downloader.Manifest = manifest
+	default:
+		// Public Falcon-style repos publish no signed manifest; fall
+		// back to the SHA256s recorded in their HF LFS pointer files.
+		sums, err := hfIndexSHA256s(downloader.Client, modelVersion, token)
+		if err != nil {
+			if *noVerify {
+				log.Printf("warning: resolving HF index SHA256s failed (continuing due to -no-verify, cache disabled for this run): %v", err)
+				break
+			}
+			return fmt.Errorf("resolving HF index SHA256s: %w", err)
+		}
+		downloader.KnownSHA256s = sums
+	}
+
+	events := make(chan ProgressEvent, 64)
+	downloader.Progress = events
+	renderer := NewTerminalRenderer()
+	rendererDone := make(chan struct{})
+	go func() {
+		renderer.Run(events)
+		close(rendererDone)
+	}()
 
+	var g errgroup.Group
 	for _, url := range urls {
-		wg.Add(1)
-		go downloadFile(outputDirectory, url, token, &wg)
+		url := url
+		g.Go(func() error {
+			if err := downloader.DownloadFile(outputDirectory, url); err != nil {
+				return fmt.Errorf("downloading %s: %w", url, err)
+			}
+			return nil
+		})
+	}
+	err = g.Wait()
+	close(events)
+	<-rendererDone
+
+	return err
+}
+
+// runGC implements the "gc" maintenance subcommand, which trims the
+// content-addressed cache down to its keepLatest most recently used blobs.
+func runGC(args []string) error {
+	fs := flag.NewFlagSet("gc", flag.ContinueOnError)
+	cacheDir := fs.String("cache-dir", defaultCacheDir(), "cache directory to garbage collect")
+	keepLatest := fs.Int("keep-latest", 0, "number of most recently used blobs to keep")
+	if err := fs.Parse(args); err != nil {
+		return err
 	}
+	return NewCache(*cacheDir).gc(*keepLatest)
+}
 
-	wg.Wait()
-}
\ No newline at end of file
+func main() {
+	var err error
+	if len(os.Args) > 1 && os.Args[1] == "gc" {
+		err = runGC(os.Args[2:])
+	} else {
+		err = run()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
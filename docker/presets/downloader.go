@@ -0,0 +1,482 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultConnections is the number of concurrent range requests used per
+	// file when the origin advertises range support.
+	defaultConnections = 8
+	partSuffix         = ".part.json"
+)
+
+// chunk describes a single byte range of a file being downloaded.
+type chunk struct {
+	Start   int64 `json:"start"`
+	End     int64 `json:"end"` // inclusive
+	Written int64 `json:"written"`
+}
+
+func (c *chunk) done() bool {
+	return c.Written >= (c.End - c.Start + 1)
+}
+
+// partState is the JSON sidecar persisted alongside a partially downloaded
+// file so a restart can resume only the unfinished byte ranges.
+type partState struct {
+	URL           string  `json:"url"`
+	ContentLength int64   `json:"content_length"`
+	ETag          string  `json:"etag,omitempty"`
+	LastModified  string  `json:"last_modified,omitempty"`
+	Chunks        []chunk `json:"chunks"`
+}
+
+func partPath(fp string) string {
+	return fp + partSuffix
+}
+
+func loadPartState(fp string) (*partState, error) {
+	data, err := os.ReadFile(partPath(fp))
+	if err != nil {
+		return nil, err
+	}
+	var st partState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+func (st *partState) save(fp string) error {
+	data, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(partPath(fp), data, 0644)
+}
+
+// Downloader drives per-file multi-connection range downloads with resume
+// support. A single Downloader can be reused across many files.
+type Downloader struct {
+	Connections int
+	Client      *http.Client
+	Token       string
+
+	// Manifest and KnownSHA256s, when set, are consulted after a file
+	// finishes downloading to verify its integrity. KnownSHA256s (keyed by
+	// filename) covers sources without a signed Manifest, such as Falcon's
+	// HF LFS pointer files.
+	Manifest     *Manifest
+	KnownSHA256s map[string]string
+	NoVerify     bool
+
+	// Progress, when set, receives a ProgressEvent per file roughly every
+	// 1% of its download plus a final event. Left nil, progress is simply
+	// not reported.
+	Progress chan<- ProgressEvent
+
+	// Cache, when set, is consulted before downloading any file whose
+	// sha256 is already known (see expectedSHA256): a cache hit hardlinks
+	// the file into place instead of re-downloading it, and a fresh
+	// download is stored into the cache for the next puller to reuse.
+	Cache *Cache
+}
+
+// NewDownloader returns a Downloader configured with connections parallel
+// range requests per file (defaultConnections if connections <= 0).
+func NewDownloader(connections int, token string) *Downloader {
+	if connections <= 0 {
+		connections = defaultConnections
+	}
+	return &Downloader{
+		Connections: connections,
+		Client:      &http.Client{},
+		Token:       token,
+	}
+}
+
+// expectedSHA256 returns the ground-truth digest for fileName, if any is
+// known from either a signed Manifest or a supplementary source such as HF
+// LFS pointers.
+func (d *Downloader) expectedSHA256(fileName string) (string, bool) {
+	if d.Manifest != nil {
+		if entry, ok := d.Manifest.entry(fileName); ok {
+			return entry.SHA256, true
+		}
+	}
+	sha, ok := d.KnownSHA256s[fileName]
+	return sha, ok
+}
+
+// verifyFile streams fp back through sha256 and compares against the
+// ground-truth digest for fileName. On mismatch the partial file is deleted
+// and a hard error returned; files with no known digest are left
+// unverified.
+func (d *Downloader) verifyFile(fp, fileName string) error {
+	if d.NoVerify {
+		return nil
+	}
+	want, ok := d.expectedSHA256(fileName)
+	if !ok {
+		return nil
+	}
+	return verifySHA256(fp, fileName, want)
+}
+
+// verifySHA256 streams fp through sha256 and compares it against want,
+// deleting fp on mismatch. Unlike Downloader.verifyFile, this never honors
+// NoVerify: it's used by downloadFileCached, where the digest being checked
+// is also the cache key, so skipping it would let unconfirmed bytes land
+// permanently in the shared cache under someone else's hash.
+func verifySHA256(fp, fileName, want string) error {
+	f, err := os.Open(fp)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	got := hex.EncodeToString(h.Sum(nil))
+	if got != want {
+		os.Remove(fp)
+		return fmt.Errorf("sha256 mismatch for %s: expected %s, got %s", fileName, want, got)
+	}
+	return nil
+}
+
+func (d *Downloader) newRequest(method, url string) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if d.Token != "" {
+		req.Header.Add("Authorization", "Bearer "+d.Token)
+	}
+	return req, nil
+}
+
+// probe issues a HEAD request (falling back to a ranged GET for servers that
+// reject HEAD) to learn the content length and whether the origin supports
+// byte-range requests.
+func (d *Downloader) probe(url string) (size int64, acceptRanges bool, etag, lastModified string, err error) {
+	resp, err := doRequestWithRetry(d.Client, func() (*http.Request, error) {
+		return d.newRequest(http.MethodHead, url)
+	})
+	if err != nil || resp.StatusCode >= 400 {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		// Some origins don't implement HEAD; fall back to a single-byte
+		// ranged GET to learn the same information.
+		resp, err = doRequestWithRetry(d.Client, func() (*http.Request, error) {
+			req, rerr := d.newRequest(http.MethodGet, url)
+			if rerr != nil {
+				return nil, rerr
+			}
+			req.Header.Set("Range", "bytes=0-0")
+			return req, nil
+		})
+		if err != nil {
+			return 0, false, "", "", err
+		}
+		defer resp.Body.Close()
+		acceptRanges = resp.StatusCode == http.StatusPartialContent
+		if cr := resp.Header.Get("Content-Range"); cr != "" {
+			fmt.Sscanf(cr, "bytes 0-0/%d", &size)
+		} else {
+			size = resp.ContentLength
+		}
+		return size, acceptRanges, resp.Header.Get("ETag"), resp.Header.Get("Last-Modified"), nil
+	}
+	defer resp.Body.Close()
+	acceptRanges = resp.Header.Get("Accept-Ranges") == "bytes"
+	return resp.ContentLength, acceptRanges, resp.Header.Get("ETag"), resp.Header.Get("Last-Modified"), nil
+}
+
+// DownloadFile downloads url into folderPath, splitting it across
+// d.Connections parallel range requests when the origin supports them and
+// falling back to a single stream otherwise. If a .part.json sidecar from a
+// previous, interrupted run is present and still matches the origin, only
+// the unfinished byte ranges are re-requested.
+func (d *Downloader) DownloadFile(folderPath, url string) error {
+	fileName := getFilenameFromURL(url)
+	fp := filepath.Join(folderPath, fileName)
+
+	if d.Cache != nil {
+		if sha, ok := d.expectedSHA256(fileName); ok {
+			return d.downloadFileCached(fp, fileName, url, sha)
+		}
+	}
+
+	return d.downloadFile(fp, fileName, url)
+}
+
+// downloadFileCached serves fp out of d.Cache when the blob for sha is
+// already present, and otherwise downloads normally before storing the
+// result into the cache for the next puller to reuse. The per-blob flock
+// coalesces concurrent invocations on the same node onto a single
+// download.
+func (d *Downloader) downloadFileCached(fp, fileName, url, sha string) error {
+	unlock, err := d.Cache.lock(sha)
+	if err != nil {
+		return fmt.Errorf("locking cache blob for %s: %w", fileName, err)
+	}
+	defer unlock()
+
+	if d.Cache.has(sha) {
+		return d.Cache.link(sha, fp)
+	}
+
+	if err := d.downloadFile(fp, fileName, url); err != nil {
+		return err
+	}
+
+	// Cache.put keys the blob off sha, so caching must never depend on
+	// d.NoVerify: an unverified (or wrongly-labeled) download could
+	// otherwise land permanently at blobs/sha256/<sha> and poison every
+	// later puller that resolves the same filename to that hash, verified
+	// or not.
+	if err := verifySHA256(fp, fileName, sha); err != nil {
+		return fmt.Errorf("refusing to cache %s: %w", fileName, err)
+	}
+	return d.Cache.put(sha, fp, fp)
+}
+
+func (d *Downloader) downloadFile(fp, fileName, url string) error {
+	size, acceptRanges, etag, lastModified, err := d.probe(url)
+	if err != nil {
+		return fmt.Errorf("probing %s: %w", url, err)
+	}
+
+	if !acceptRanges || size <= 0 {
+		if err := d.downloadSingleStream(fp, fileName, url, size); err != nil {
+			return err
+		}
+		return d.verifyFile(fp, fileName)
+	}
+
+	st, err := loadPartState(fp)
+	if err != nil || st.ContentLength != size || (etag != "" && st.ETag != etag) || (lastModified != "" && st.LastModified != lastModified) {
+		st = &partState{
+			URL:           url,
+			ContentLength: size,
+			ETag:          etag,
+			LastModified:  lastModified,
+			Chunks:        splitChunks(size, d.Connections),
+		}
+	}
+
+	if err := preallocate(fp, size); err != nil {
+		return fmt.Errorf("preallocating %s: %w", fp, err)
+	}
+
+	progress := newAggregateCounter(fileName, size, d.Progress)
+	for i := range st.Chunks {
+		progress.add(st.Chunks[i].Written)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(st.Chunks))
+	for i := range st.Chunks {
+		c := &st.Chunks[i]
+		if c.done() {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, c *chunk) {
+			defer wg.Done()
+			errs[i] = d.downloadChunkWithRetry(fp, url, c, progress)
+		}(i, c)
+	}
+	wg.Wait()
+
+	var firstErr error
+	for _, e := range errs {
+		if e != nil && firstErr == nil {
+			firstErr = e
+		}
+	}
+	progress.finish(firstErr)
+
+	if firstErr != nil {
+		_ = st.save(fp)
+		return firstErr
+	}
+
+	if err := d.verifyFile(fp, fileName); err != nil {
+		return err
+	}
+
+	if err := os.Remove(partPath(fp)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func splitChunks(size int64, connections int) []chunk {
+	chunkSize := size / int64(connections)
+	chunks := make([]chunk, 0, connections)
+	start := int64(0)
+	for i := 0; i < connections; i++ {
+		end := start + chunkSize - 1
+		if i == connections-1 {
+			end = size - 1
+		}
+		chunks = append(chunks, chunk{Start: start, End: end})
+		start = end + 1
+	}
+	return chunks
+}
+
+func preallocate(fp string, size int64) error {
+	out, err := os.OpenFile(fp, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	return out.Truncate(size)
+}
+
+// downloadChunkWithRetry retries a chunk's range request up to maxAttempts
+// times with backoff. Because c.Written is advanced after every partial
+// write, a retry re-requests only the bytes still missing from the chunk
+// rather than restarting it.
+func (d *Downloader) downloadChunkWithRetry(fp, url string, c *chunk, progress *aggregateCounter) error {
+	var lastErr error
+	backoff := initialBackoff
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		if c.done() {
+			return nil
+		}
+		if attempt > 0 {
+			time.Sleep(backoff + jitter(backoff))
+			backoff = nextBackoff(backoff)
+		}
+
+		err := d.downloadChunk(fp, url, c, progress)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if !isRetryableChunkError(err) {
+			return err
+		}
+	}
+	return fmt.Errorf("chunk bytes=%d-%d of %s: giving up after %d attempts: %w", c.Start, c.End, url, maxAttempts, lastErr)
+}
+
+func isRetryableChunkError(err error) bool {
+	var statusErr *retryableStatusError
+	if errors.As(err, &statusErr) {
+		return true
+	}
+	return isRetryableNetError(err)
+}
+
+func (d *Downloader) downloadChunk(fp, url string, c *chunk, progress *aggregateCounter) error {
+	start := c.Start + c.Written
+	if start > c.End {
+		return nil
+	}
+
+	resp, err := doRequestWithRetry(d.Client, func() (*http.Request, error) {
+		req, err := d.newRequest(http.MethodGet, url)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, c.End))
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return fmt.Errorf("range request to %s returned status %d", url, resp.StatusCode)
+	}
+
+	out, err := os.OpenFile(fp, os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	writer := &offsetWriter{f: out, offset: start}
+	tee := io.TeeReader(resp.Body, progress)
+	written, err := io.Copy(writer, tee)
+	c.Written += written
+	return err
+}
+
+// offsetWriter writes sequentially into f starting at a fixed file offset,
+// so concurrent chunk downloads, each with its own *os.File, can write
+// independent regions of the same file (WriteAt).
+type offsetWriter struct {
+	f      *os.File
+	offset int64
+}
+
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	n, err := w.f.WriteAt(p, w.offset)
+	w.offset += int64(n)
+	return n, err
+}
+
+func (d *Downloader) downloadSingleStream(fp, fileName, url string, totalBytes int64) error {
+	var lastErr error
+	backoff := initialBackoff
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff + jitter(backoff))
+			backoff = nextBackoff(backoff)
+		}
+		err := d.downloadSingleStreamOnce(fp, fileName, url, totalBytes)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if !isRetryableChunkError(err) {
+			return err
+		}
+	}
+	return fmt.Errorf("downloading %s: giving up after %d attempts: %w", url, maxAttempts, lastErr)
+}
+
+func (d *Downloader) downloadSingleStreamOnce(fp, fileName, url string, totalBytes int64) error {
+	out, err := os.Create(fp)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	resp, err := doRequestWithRetry(d.Client, func() (*http.Request, error) {
+		return d.newRequest(http.MethodGet, url)
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if totalBytes <= 0 {
+		totalBytes = resp.ContentLength
+	}
+	progress := newAggregateCounter(fileName, totalBytes, d.Progress)
+	tee := io.TeeReader(resp.Body, progress)
+	_, err = io.Copy(out, tee)
+	progress.finish(err)
+	return err
+}
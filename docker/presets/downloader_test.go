@@ -0,0 +1,134 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSplitChunksCoversWholeFileExactly(t *testing.T) {
+	for _, tc := range []struct {
+		size        int64
+		connections int
+	}{
+		{size: 100, connections: 8},
+		{size: 1, connections: 8},
+		{size: 7, connections: 3},
+		{size: 1024, connections: 1},
+	} {
+		chunks := splitChunks(tc.size, tc.connections)
+		if len(chunks) != tc.connections {
+			t.Fatalf("size=%d connections=%d: got %d chunks, want %d", tc.size, tc.connections, len(chunks), tc.connections)
+		}
+		if chunks[0].Start != 0 {
+			t.Fatalf("size=%d connections=%d: first chunk starts at %d, want 0", tc.size, tc.connections, chunks[0].Start)
+		}
+		if got := chunks[len(chunks)-1].End; got != tc.size-1 {
+			t.Fatalf("size=%d connections=%d: last chunk ends at %d, want %d", tc.size, tc.connections, got, tc.size-1)
+		}
+		for i := 1; i < len(chunks); i++ {
+			if chunks[i].Start != chunks[i-1].End+1 {
+				t.Fatalf("size=%d connections=%d: gap/overlap between chunk %d and %d", tc.size, tc.connections, i-1, i)
+			}
+		}
+	}
+}
+
+func TestChunkDone(t *testing.T) {
+	c := chunk{Start: 10, End: 19} // 10 bytes, inclusive range
+	if c.done() {
+		t.Fatal("chunk with 0 bytes written reported done")
+	}
+	c.Written = 9
+	if c.done() {
+		t.Fatal("chunk missing its last byte reported done")
+	}
+	c.Written = 10
+	if !c.done() {
+		t.Fatal("chunk with every byte written reported not done")
+	}
+}
+
+// TestDownloadChunkRequestsOnlyMissingBytes drives downloadChunk against a
+// real httptest.Server and asserts the Range header it actually sends skips
+// the bytes the chunk already has, rather than recomputing the offset
+// inline and checking it against itself.
+func TestDownloadChunkRequestsOnlyMissingBytes(t *testing.T) {
+	content := []byte("0123456789")
+	var gotRange string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotRange = r.Header.Get("Range")
+		start := 0
+		fmt.Sscanf(gotRange, "bytes=%d-", &start)
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(content)-1, len(content)))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(content[start:])
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	fp := filepath.Join(dir, "file")
+	if err := preallocate(fp, int64(len(content))); err != nil {
+		t.Fatalf("preallocate: %v", err)
+	}
+
+	c := &chunk{Start: 0, End: int64(len(content) - 1), Written: 4}
+	d := NewDownloader(1, "")
+	progress := newAggregateCounter("file", int64(len(content)), nil)
+
+	if err := d.downloadChunk(fp, srv.URL, c, progress); err != nil {
+		t.Fatalf("downloadChunk: %v", err)
+	}
+
+	if gotRange != "bytes=4-9" {
+		t.Fatalf("server received Range %q, want \"bytes=4-9\" (resuming from the 4 bytes already written)", gotRange)
+	}
+	if !c.done() {
+		t.Fatalf("chunk not marked done after its full range was written, Written=%d", c.Written)
+	}
+
+	got, err := os.ReadFile(fp)
+	if err != nil {
+		t.Fatalf("reading downloaded file: %v", err)
+	}
+	want := append([]byte{0, 0, 0, 0}, content[4:]...)
+	if string(got) != string(want) {
+		t.Fatalf("file contents = %q, want %q", got, want)
+	}
+}
+
+// TestDownloadFileCachedRefusesToCacheOnHashMismatch is a regression test
+// for a cache-poisoning bug: with NoVerify set, a download whose content
+// doesn't actually match the hash it was looked up under must not be stored
+// in the cache under that hash, since every later puller (verified or not)
+// would then silently receive the wrong bytes for that filename.
+func TestDownloadFileCachedRefusesToCacheOnHashMismatch(t *testing.T) {
+	content := []byte("the actual content served by the origin")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	}))
+	defer srv.Close()
+
+	fp := filepath.Join(t.TempDir(), "file")
+	d := NewDownloader(1, "")
+	d.NoVerify = true
+	d.Cache = NewCache(t.TempDir())
+
+	wrongSHA := sha256Hex([]byte("WRONG CONTENT"))
+	if err := d.downloadFileCached(fp, "file", srv.URL, wrongSHA); err == nil {
+		t.Fatal("expected downloadFileCached to refuse a hash mismatch even with NoVerify set")
+	}
+	if d.Cache.has(wrongSHA) {
+		t.Fatal("mismatched content must never be stored under the wrong hash, even with -no-verify")
+	}
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+// ProgressEvent reports how much of a file has been downloaded so far. It's
+// emitted once per meaningful update (roughly every 1% of the file, plus a
+// final event) so a UI layer (terminal multi-bar, JSON lines for CI, a
+// future Kaito controller) can consume progress uniformly without caring
+// how many connections are writing to the file underneath.
+type ProgressEvent struct {
+	File  string
+	Bytes int64
+	Total int64
+	Err   error
+}
+
+// aggregateCounter merges the progress of every chunk downloading a single
+// file into one unified stream of ProgressEvents, so splitting a file
+// across multiple connections doesn't change the shape of the reported
+// progress.
+type aggregateCounter struct {
+	mu           sync.Mutex
+	filename     string
+	total        int64
+	read         int64
+	lastReported int64
+	events       chan<- ProgressEvent
+}
+
+func newAggregateCounter(filename string, total int64, events chan<- ProgressEvent) *aggregateCounter {
+	return &aggregateCounter{filename: filename, total: total, events: events}
+}
+
+func (c *aggregateCounter) add(n int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.read += n
+}
+
+// Write implements io.Writer so an aggregateCounter can sit behind an
+// io.TeeReader for each chunk, or for the whole body of a single-stream
+// download.
+func (c *aggregateCounter) Write(p []byte) (int, error) {
+	n := len(p)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.read += int64(n)
+	if c.total <= 0 {
+		return n, nil
+	}
+
+	onePercent := c.total / 100
+	if onePercent == 0 || c.read-c.lastReported >= onePercent {
+		c.emit(c.read)
+		c.lastReported = c.read
+	}
+
+	return n, nil
+}
+
+func (c *aggregateCounter) emit(read int64) {
+	if c.events == nil {
+		return
+	}
+	c.events <- ProgressEvent{File: c.filename, Bytes: read, Total: c.total}
+}
+
+func (c *aggregateCounter) finish(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.events == nil {
+		return
+	}
+	if err != nil {
+		c.events <- ProgressEvent{File: c.filename, Bytes: c.read, Total: c.total, Err: err}
+		return
+	}
+	// Report c.read, not c.total: for a single-stream download with an
+	// unknown Content-Length (c.total <= 0), Write never calls emit, so
+	// c.read holds the only real byte count this file ever reports.
+	c.events <- ProgressEvent{File: c.filename, Bytes: c.read, Total: c.total}
+}
+
+// TerminalRenderer is the default progress UI: one line per concurrent
+// file, redrawn in place with ANSI cursor movement instead of interleaving
+// \n-terminated updates.
+type TerminalRenderer struct {
+	mu    sync.Mutex
+	order []string
+	lines map[string]string
+	drawn int
+}
+
+func NewTerminalRenderer() *TerminalRenderer {
+	return &TerminalRenderer{lines: map[string]string{}}
+}
+
+// Run consumes events until the channel is closed, redrawing the terminal
+// block after each one. Intended to run in its own goroutine.
+func (r *TerminalRenderer) Run(events <-chan ProgressEvent) {
+	for ev := range events {
+		r.update(ev)
+	}
+}
+
+func (r *TerminalRenderer) update(ev ProgressEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.lines[ev.File]; !ok {
+		r.order = append(r.order, ev.File)
+	}
+	r.lines[ev.File] = formatProgressLine(ev)
+
+	if r.drawn > 0 {
+		fmt.Printf("\x1b[%dA", r.drawn)
+	}
+	for _, f := range r.order {
+		fmt.Printf("\r\x1b[K%s\n", r.lines[f])
+	}
+	r.drawn = len(r.order)
+}
+
+func formatProgressLine(ev ProgressEvent) string {
+	if ev.Err != nil {
+		return fmt.Sprintf("Downloading [%s]: error: %v", ev.File, ev.Err)
+	}
+	if ev.Total <= 0 {
+		return fmt.Sprintf("Downloading [%s]: %d bytes", ev.File, ev.Bytes)
+	}
+	pct := float64(ev.Bytes) / float64(ev.Total) * 100
+	return fmt.Sprintf("Downloading [%s]: %d out of %d bytes (%.2f%%)", ev.File, ev.Bytes, ev.Total, pct)
+}
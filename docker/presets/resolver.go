@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+)
+
+// weightRelevantPattern matches the sibling filenames worth downloading out
+// of an HF repo listing: model weights, tokenizer assets, config files, and
+// the custom modeling/configuration .py files that trust_remote_code=True
+// repos like Falcon need to load at all (the baseline hardcoded file list
+// this replaces always fetched configuration_falcon.py/modeling_falcon.py;
+// dropping them would silently break loading those models). Anything else
+// (README, .gitattributes, example notebooks, ...) is skipped.
+var weightRelevantPattern = regexp.MustCompile(`(?i)(\.bin$|\.safetensors$|\.pth$|^tokenizer|config.*\.json$|^generation_config\.json$|^special_tokens_map\.json$|\.index\.json$|^(modeling|configuration)_.*\.py$)`)
+
+var weightShardPattern = regexp.MustCompile(`(?i)\.(bin|safetensors|pth)$`)
+
+type hfSibling struct {
+	RFilename string `json:"rfilename"`
+}
+
+type hfModelInfo struct {
+	Siblings []hfSibling `json:"siblings"`
+}
+
+// HuggingFaceResolver discovers a model repo's weight files via the Hugging
+// Face Hub API instead of a hardcoded shard count, so any HF repo id can be
+// used as <model_version> without a code change.
+type HuggingFaceResolver struct {
+	Client *http.Client
+	Token  string
+}
+
+func NewHuggingFaceResolver(token string) *HuggingFaceResolver {
+	return &HuggingFaceResolver{Client: &http.Client{}, Token: token}
+}
+
+// ResolveFiles returns the resolve/main download URLs for every
+// weight-relevant file in modelVersion (a Hugging Face repo id). When the
+// repo publishes a pytorch_model.bin.index.json or
+// model.safetensors.index.json, its weight_map pins down the exact shard
+// filenames, which take precedence over the sibling listing's guesses.
+func (r *HuggingFaceResolver) ResolveFiles(modelVersion string) ([]string, error) {
+	apiURL := fmt.Sprintf("https://huggingface.co/api/models/%s?blobs=true", modelVersion)
+	body, err := httpGetBody(r.Client, apiURL, r.Token)
+	if err != nil {
+		return nil, fmt.Errorf("querying HF hub API for %s: %w", modelVersion, err)
+	}
+
+	var info hfModelInfo
+	if err := json.Unmarshal(body, &info); err != nil {
+		return nil, fmt.Errorf("parsing HF hub API response for %s: %w", modelVersion, err)
+	}
+
+	var indexFile string
+	var others []string
+	for _, s := range info.Siblings {
+		switch {
+		case isShardIndex(s.RFilename):
+			indexFile = s.RFilename
+		case weightRelevantPattern.MatchString(s.RFilename):
+			others = append(others, s.RFilename)
+		}
+	}
+
+	if indexFile == "" {
+		return resolveURLs(modelVersion, others), nil
+	}
+
+	shards, err := r.shardsFromIndex(modelVersion, indexFile)
+	if err != nil {
+		return nil, err
+	}
+
+	files := append([]string{indexFile}, shards...)
+	for _, f := range others {
+		if !weightShardPattern.MatchString(f) {
+			files = append(files, f)
+		}
+	}
+	return resolveURLs(modelVersion, files), nil
+}
+
+func (r *HuggingFaceResolver) shardsFromIndex(modelVersion, indexFile string) ([]string, error) {
+	url := fmt.Sprintf("https://huggingface.co/%s/raw/main/%s", modelVersion, indexFile)
+	body, err := httpGetBody(r.Client, url, r.Token)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %w", indexFile, err)
+	}
+
+	var index struct {
+		WeightMap map[string]string `json:"weight_map"`
+	}
+	if err := json.Unmarshal(body, &index); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", indexFile, err)
+	}
+	return dedupShardFilenames(index.WeightMap), nil
+}
+
+// dedupShardFilenames returns the distinct shard filenames referenced by an
+// index's weight_map (which maps many tensor names onto a much smaller set
+// of shard files), in no particular order.
+func dedupShardFilenames(weightMap map[string]string) []string {
+	seen := map[string]bool{}
+	var shards []string
+	for _, shard := range weightMap {
+		if !seen[shard] {
+			seen[shard] = true
+			shards = append(shards, shard)
+		}
+	}
+	return shards
+}
+
+func isShardIndex(filename string) bool {
+	return filename == "pytorch_model.bin.index.json" || filename == "model.safetensors.index.json"
+}
+
+func resolveURLs(modelVersion string, files []string) []string {
+	urls := make([]string, 0, len(files))
+	for _, f := range files {
+		urls = append(urls, fmt.Sprintf("https://huggingface.co/%s/resolve/main/%s", modelVersion, f))
+	}
+	return urls
+}
@@ -0,0 +1,96 @@
+package main
+
+import "testing"
+
+func TestIsShardIndex(t *testing.T) {
+	cases := map[string]bool{
+		"pytorch_model.bin.index.json": true,
+		"model.safetensors.index.json": true,
+		"pytorch_model.bin":            false,
+		"config.json":                  false,
+	}
+	for name, want := range cases {
+		if got := isShardIndex(name); got != want {
+			t.Errorf("isShardIndex(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestResolveURLs(t *testing.T) {
+	got := resolveURLs("tiiuae/falcon-7b", []string{"config.json", "pytorch_model-00001-of-00002.bin"})
+	want := []string{
+		"https://huggingface.co/tiiuae/falcon-7b/resolve/main/config.json",
+		"https://huggingface.co/tiiuae/falcon-7b/resolve/main/pytorch_model-00001-of-00002.bin",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("resolveURLs returned %d urls, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("resolveURLs()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestWeightRelevantPatternMatchesFalconCustomCode(t *testing.T) {
+	relevant := []string{
+		"pytorch_model.bin",
+		"model.safetensors",
+		"consolidated.00.pth",
+		"tokenizer.json",
+		"tokenizer_config.json",
+		"config.json",
+		"generation_config.json",
+		"special_tokens_map.json",
+		"pytorch_model.bin.index.json",
+		"configuration_falcon.py",
+		"modeling_falcon.py",
+	}
+	for _, name := range relevant {
+		if !weightRelevantPattern.MatchString(name) {
+			t.Errorf("weightRelevantPattern should match %q", name)
+		}
+	}
+
+	irrelevant := []string{"README.md", ".gitattributes", "notebook.ipynb"}
+	for _, name := range irrelevant {
+		if weightRelevantPattern.MatchString(name) {
+			t.Errorf("weightRelevantPattern should not match %q", name)
+		}
+	}
+}
+
+func TestWeightShardPattern(t *testing.T) {
+	if !weightShardPattern.MatchString("pytorch_model-00001-of-00002.bin") {
+		t.Error("weightShardPattern should match a .bin shard")
+	}
+	if weightShardPattern.MatchString("config.json") {
+		t.Error("weightShardPattern should not match config.json")
+	}
+}
+
+func TestDedupShardFilenames(t *testing.T) {
+	weightMap := map[string]string{
+		"model.layers.0.weight": "pytorch_model-00001-of-00002.bin",
+		"model.layers.1.weight": "pytorch_model-00001-of-00002.bin",
+		"model.layers.2.weight": "pytorch_model-00002-of-00002.bin",
+	}
+
+	got := dedupShardFilenames(weightMap)
+
+	seen := map[string]bool{}
+	for _, f := range got {
+		if seen[f] {
+			t.Fatalf("dedupShardFilenames returned %q more than once", f)
+		}
+		seen[f] = true
+	}
+	if len(got) != 2 {
+		t.Fatalf("dedupShardFilenames returned %d shards, want 2", len(got))
+	}
+	for _, want := range []string{"pytorch_model-00001-of-00002.bin", "pytorch_model-00002-of-00002.bin"} {
+		if !seen[want] {
+			t.Errorf("dedupShardFilenames missing %q", want)
+		}
+	}
+}
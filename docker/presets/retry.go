@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	maxAttempts    = 5
+	initialBackoff = 1 * time.Second
+	maxBackoff     = 30 * time.Second
+)
+
+// retryableStatusError wraps an HTTP response status that's worth retrying
+// (429 or 5xx), so callers further up the stack can tell a transient
+// server condition apart from a hard failure.
+type retryableStatusError struct {
+	status int
+}
+
+func (e *retryableStatusError) Error() string {
+	return fmt.Sprintf("http status %d", e.status)
+}
+
+// doRequestWithRetry runs requestFactory and client.Do up to maxAttempts
+// times with exponential backoff and jitter, retrying transient network
+// errors (net.OpError, EOF before a response arrives), HTTP 5xx, and HTTP
+// 429 (honoring Retry-After). It never reads the response body, so an EOF
+// mid-body surfaces to the caller's own retry loop (downloadChunkWithRetry,
+// downloadSingleStream). requestFactory is called fresh on every attempt since an
+// *http.Request can't be replayed once its body has been consumed.
+func doRequestWithRetry(client *http.Client, requestFactory func() (*http.Request, error)) (*http.Response, error) {
+	var lastErr error
+	backoff := initialBackoff
+
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff + jitter(backoff))
+			backoff = nextBackoff(backoff)
+		}
+
+		req, err := requestFactory()
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			lastErr = err
+			if isRetryableNetError(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		switch {
+		case resp.StatusCode == http.StatusTooManyRequests:
+			wait := retryAfter(resp.Header.Get("Retry-After"), backoff)
+			resp.Body.Close()
+			lastErr = &retryableStatusError{resp.StatusCode}
+			time.Sleep(wait)
+			continue
+		case resp.StatusCode >= 500:
+			resp.Body.Close()
+			lastErr = &retryableStatusError{resp.StatusCode}
+			continue
+		}
+
+		return resp, nil
+	}
+
+	return nil, fmt.Errorf("giving up after %d attempts: %w", maxAttempts, lastErr)
+}
+
+func nextBackoff(backoff time.Duration) time.Duration {
+	backoff *= 2
+	if backoff > maxBackoff {
+		return maxBackoff
+	}
+	return backoff
+}
+
+func jitter(backoff time.Duration) time.Duration {
+	if backoff <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(backoff)))
+}
+
+func retryAfter(header string, fallback time.Duration) time.Duration {
+	if header == "" {
+		return fallback
+	}
+	if secs, err := strconv.Atoi(header); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if when, err := http.ParseTime(header); err == nil {
+		if wait := time.Until(when); wait > 0 {
+			return wait
+		}
+	}
+	return fallback
+}
+
+// isRetryableNetError reports whether err looks like a transient condition
+// worth retrying, as opposed to a permanent failure (bad URL, DNS NXDOMAIN,
+// TLS verification failure, etc).
+func isRetryableNetError(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return false
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return true
+	}
+	return errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNextBackoffDoublesAndCaps(t *testing.T) {
+	if got := nextBackoff(1 * time.Second); got != 2*time.Second {
+		t.Fatalf("nextBackoff(1s) = %v, want 2s", got)
+	}
+
+	b := initialBackoff
+	for i := 0; i < 10; i++ {
+		b = nextBackoff(b)
+	}
+	if b != maxBackoff {
+		t.Fatalf("backoff should saturate at maxBackoff (%v), got %v", maxBackoff, b)
+	}
+}
+
+func TestJitterStaysWithinBounds(t *testing.T) {
+	if got := jitter(0); got != 0 {
+		t.Fatalf("jitter(0) = %v, want 0", got)
+	}
+	backoff := 2 * time.Second
+	for i := 0; i < 100; i++ {
+		if j := jitter(backoff); j < 0 || j >= backoff {
+			t.Fatalf("jitter(%v) = %v, want [0, %v)", backoff, j, backoff)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	fallback := 5 * time.Second
+
+	if got := retryAfter("", fallback); got != fallback {
+		t.Fatalf("retryAfter(\"\") = %v, want fallback %v", got, fallback)
+	}
+	if got := retryAfter("3", fallback); got != 3*time.Second {
+		t.Fatalf("retryAfter(\"3\") = %v, want 3s", got)
+	}
+	if got := retryAfter("not-a-date-or-number", fallback); got != fallback {
+		t.Fatalf("retryAfter(garbage) = %v, want fallback %v", got, fallback)
+	}
+
+	future := time.Now().Add(10 * time.Second).UTC()
+	if got := retryAfter(future.Format(http.TimeFormat), fallback); got <= 0 || got > 11*time.Second {
+		t.Fatalf("retryAfter(http-date ~10s out) = %v, want roughly 10s", got)
+	}
+}
+
+func TestIsRetryableNetError(t *testing.T) {
+	if !isRetryableNetError(io.EOF) {
+		t.Error("io.EOF should be retryable")
+	}
+	if !isRetryableNetError(io.ErrUnexpectedEOF) {
+		t.Error("io.ErrUnexpectedEOF should be retryable")
+	}
+	if !isRetryableNetError(&net.OpError{Op: "dial", Err: errors.New("connection refused")}) {
+		t.Error("a net.OpError should be retryable")
+	}
+	if isRetryableNetError(errors.New("some permanent error")) {
+		t.Error("an arbitrary error should not be classified as retryable")
+	}
+}
+
+func TestDoRequestWithRetryRetriesOn429ThenSucceeds(t *testing.T) {
+	var attempts int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 2 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	resp, err := doRequestWithRetry(srv.Client(), func() (*http.Request, error) {
+		return http.NewRequest(http.MethodGet, srv.URL, nil)
+	})
+	if err != nil {
+		t.Fatalf("doRequestWithRetry: %v", err)
+	}
+	resp.Body.Close()
+	if attempts != 2 {
+		t.Fatalf("expected exactly 2 attempts (1 retry after a 429), got %d", attempts)
+	}
+}
+
+func TestDoRequestWithRetryDoesNotRetryOn404(t *testing.T) {
+	var attempts int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	resp, err := doRequestWithRetry(srv.Client(), func() (*http.Request, error) {
+		return http.NewRequest(http.MethodGet, srv.URL, nil)
+	})
+	if err != nil {
+		t.Fatalf("doRequestWithRetry: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("status = %d, want 404", resp.StatusCode)
+	}
+	if attempts != 1 {
+		t.Fatalf("expected exactly 1 attempt for a non-retryable 404, got %d", attempts)
+	}
+}
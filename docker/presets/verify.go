@@ -0,0 +1,226 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// trustedRootKeys are the Ed25519 public keys (hex-encoded) this binary
+// accepts manifest signatures from. Keys are rotated by appending a new
+// entry here and keeping the old one until every manifest signed with it
+// has expired; signing_key_id in the manifest picks which key verified it.
+//
+// No root key has been provisioned yet, so this starts empty. Until a real
+// key ships here, verifySignature hard-fails manifest verification unless
+// the caller explicitly opts into --insecure-skip-signature — see
+// verifySignature.
+var trustedRootKeys = map[string]ed25519.PublicKey{
+	// "2024-kaito-weights-1": mustDecodeHexKey("..."),
+}
+
+// ManifestEntry describes one file a Manifest vouches for.
+type ManifestEntry struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest is the canonical, signed description of every file that makes
+// up a model version. It is fetched (and verified) before any weight bytes
+// are read, mirroring how distribution signing verifies a release manifest
+// before unpacking it.
+type Manifest struct {
+	Files        []ManifestEntry `json:"files"`
+	Signature    string          `json:"signature"`
+	SigningKeyID string          `json:"signing_key_id"`
+
+	raw []byte // the exact bytes the signature was computed over
+}
+
+func (m *Manifest) entry(path string) (ManifestEntry, bool) {
+	for _, f := range m.Files {
+		if f.Path == path {
+			return f, true
+		}
+	}
+	return ManifestEntry{}, false
+}
+
+// verifySignature checks the detached signature in m.Signature against
+// m.raw — the exact bytes of manifest.json as received, not a round-tripped
+// re-encoding of it, since nothing guarantees the signer's JSON encoder
+// produces byte-identical output to Go's.
+//
+// No trusted root key has shipped in this binary yet (see trustedRootKeys),
+// so there is currently no way to actually check a manifest's signature.
+// That's a hard error unless the caller passes allowUnsigned (wired up to
+// --insecure-skip-signature in download_script.go): shipping a feature
+// advertised as "signed manifest verification" that silently verifies
+// nothing by default isn't acceptable, even though per-file SHA256 checks
+// still run regardless. Once a real key is provisioned, an unknown
+// signing_key_id goes back to always being a hard error.
+func (m *Manifest) verifySignature(allowUnsigned bool) error {
+	if len(trustedRootKeys) == 0 {
+		if !allowUnsigned {
+			return fmt.Errorf("no trusted manifest signing keys are embedded in this binary; re-run with --insecure-skip-signature (or -no-verify) to proceed without checking manifest signatures")
+		}
+		log.Printf("warning: no trusted manifest signing keys are embedded in this binary; skipping manifest signature verification per --insecure-skip-signature or -no-verify (per-file SHA256 checks still apply)")
+		return nil
+	}
+
+	key, ok := trustedRootKeys[m.SigningKeyID]
+	if !ok {
+		return fmt.Errorf("manifest signed with unknown key id %q", m.SigningKeyID)
+	}
+	sig, err := hex.DecodeString(strings.TrimSpace(m.Signature))
+	if err != nil {
+		return fmt.Errorf("decoding manifest signature: %w", err)
+	}
+
+	if !ed25519.Verify(key, m.raw, sig) {
+		return fmt.Errorf("manifest signature verification failed")
+	}
+	return nil
+}
+
+// fetchManifest downloads <baseURL>/<modelVersion>/manifest.json and its
+// detached .sig, verifying the Ed25519 signature before returning.
+// allowUnsigned is threaded through to verifySignature (see its doc
+// comment); the caller is download_script.go's -no-verify/
+// -insecure-skip-signature flags.
+func fetchManifest(client *http.Client, baseURL, modelVersion, token string, allowUnsigned bool) (*Manifest, error) {
+	manifestURL := fmt.Sprintf("%s%s/manifest.json", baseURL, modelVersion)
+	sigURL := manifestURL + ".sig"
+
+	body, err := httpGetBody(client, manifestURL, token)
+	if err != nil {
+		return nil, fmt.Errorf("fetching manifest: %w", err)
+	}
+	sig, err := httpGetBody(client, sigURL, token)
+	if err != nil {
+		return nil, fmt.Errorf("fetching manifest signature: %w", err)
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(body, &m); err != nil {
+		return nil, fmt.Errorf("parsing manifest: %w", err)
+	}
+	m.Signature = string(sig)
+	m.raw = body
+
+	if err := m.verifySignature(allowUnsigned); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// loadManifestFile reads a manifest from a local path, for the
+// --manifest=<path> offline override. The signature is still verified
+// (see fetchManifest for allowUnsigned).
+func loadManifestFile(path string, allowUnsigned bool) (*Manifest, error) {
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := os.ReadFile(path + ".sig")
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(body, &m); err != nil {
+		return nil, fmt.Errorf("parsing manifest %s: %w", path, err)
+	}
+	m.Signature = string(sig)
+	m.raw = body
+
+	if err := m.verifySignature(allowUnsigned); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func httpGetBody(client *http.Client, url, token string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Add("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: status %d", url, resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// hfIndexSHA256s extracts ground-truth SHA256s for public Hugging Face
+// repos from model.safetensors.index.json / pytorch_model.bin.index.json
+// style LFS pointer files, for use when no signed manifest is published
+// (e.g. Falcon).
+func hfIndexSHA256s(client *http.Client, modelVersion, token string) (map[string]string, error) {
+	sums := map[string]string{}
+	for _, shard := range []string{"pytorch_model.bin.index.json", "model.safetensors.index.json"} {
+		url := fmt.Sprintf("https://huggingface.co/%s/raw/main/%s", modelVersion, shard)
+		body, err := httpGetBody(client, url, token)
+		if err != nil {
+			continue // index files are optional; not every repo has one
+		}
+		var index struct {
+			WeightMap map[string]string `json:"weight_map"`
+		}
+		if err := json.Unmarshal(body, &index); err != nil {
+			continue
+		}
+		for _, file := range index.WeightMap {
+			lfsURL := fmt.Sprintf("https://huggingface.co/%s/raw/main/%s", modelVersion, file)
+			pointer, err := httpGetBody(client, lfsURL, token)
+			if err != nil {
+				continue
+			}
+			if sha, ok := parseLFSPointerSHA256(pointer); ok {
+				sums[filepath.Base(file)] = sha
+			}
+		}
+	}
+	return sums, nil
+}
+
+// parseLFSPointerSHA256 extracts the oid from a Git LFS pointer file body,
+// e.g. "oid sha256:<hex>".
+func parseLFSPointerSHA256(pointer []byte) (string, bool) {
+	const prefix = "oid sha256:"
+	for _, line := range splitLines(pointer) {
+		if len(line) > len(prefix) && line[:len(prefix)] == prefix {
+			return line[len(prefix):], true
+		}
+	}
+	return "", false
+}
+
+func splitLines(b []byte) []string {
+	var lines []string
+	start := 0
+	for i, c := range b {
+		if c == '\n' {
+			lines = append(lines, string(b[start:i]))
+			start = i + 1
+		}
+	}
+	if start < len(b) {
+		lines = append(lines, string(b[start:]))
+	}
+	return lines
+}
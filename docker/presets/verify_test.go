@@ -0,0 +1,56 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"testing"
+)
+
+func TestVerifySignatureFailsClosedWithNoTrustedKeysUnlessAllowed(t *testing.T) {
+	if len(trustedRootKeys) != 0 {
+		t.Skip("trustedRootKeys is populated; the no-trusted-keys path is not exercised")
+	}
+	m := &Manifest{SigningKeyID: "whatever", raw: []byte(`{"files":[]}`)}
+
+	if err := m.verifySignature(false); err == nil {
+		t.Fatal("expected verifySignature to hard-fail with no trusted keys and allowUnsigned=false")
+	}
+	if err := m.verifySignature(true); err != nil {
+		t.Fatalf("expected verifySignature to fail open when allowUnsigned=true, got: %v", err)
+	}
+}
+
+func TestVerifySignatureChecksRawBytesNotARoundTrip(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generating test key: %v", err)
+	}
+
+	const keyID = "test-key"
+	saved := trustedRootKeys
+	trustedRootKeys = map[string]ed25519.PublicKey{keyID: pub}
+	defer func() { trustedRootKeys = saved }()
+
+	// Deliberately formatted differently than Go's encoding/json would
+	// produce (spacing, key order) to prove verification checks these
+	// exact bytes rather than a re-marshaled copy of the parsed struct.
+	raw := []byte(`{"signing_key_id": "test-key", "files": [{"path":"a","size":1,"sha256":"abc"}]}`)
+	sig := ed25519.Sign(priv, raw)
+
+	m := &Manifest{SigningKeyID: keyID, Signature: hex.EncodeToString(sig), raw: raw}
+	if err := m.verifySignature(false); err != nil {
+		t.Fatalf("expected valid signature over raw bytes to verify, got: %v", err)
+	}
+
+	tampered := append([]byte(nil), raw...)
+	tampered[10] ^= 0xFF
+	m.raw = tampered
+	if err := m.verifySignature(false); err == nil {
+		t.Fatal("expected a tampered manifest body to fail verification")
+	}
+
+	m2 := &Manifest{SigningKeyID: "unknown-key-id", Signature: hex.EncodeToString(sig), raw: raw}
+	if err := m2.verifySignature(false); err == nil {
+		t.Fatal("expected an unknown signing_key_id to fail verification")
+	}
+}